@@ -0,0 +1,324 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry tracks every in-flight Proxy, keyed by its connection ID, so an
+// admin API can list, inspect and reconfigure connections at runtime
+// without restarting the process.
+type Registry struct {
+	mu    sync.Mutex
+	conns map[string]*Proxy
+
+	// Upstream is consulted by the accept loop for new connections; hot
+	// swapping it does not affect connections already in conns.
+	upstreamMu sync.RWMutex
+	upstream   string
+}
+
+// NewRegistry creates an empty Registry seeded with the given default
+// upstream address.
+func NewRegistry(defaultUpstream string) *Registry {
+	return &Registry{
+		conns:    make(map[string]*Proxy),
+		upstream: defaultUpstream,
+	}
+}
+
+// Add registers p under id so it shows up in List/Get until Remove is called.
+func (r *Registry) Add(id string, p *Proxy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conns[id] = p
+}
+
+// Remove drops id from the registry, e.g. once its Proxy.Start has returned.
+func (r *Registry) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, id)
+}
+
+// Get returns the Proxy registered under id, if any.
+func (r *Registry) Get(id string) (*Proxy, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.conns[id]
+	return p, ok
+}
+
+// Upstream returns the address new connections should be dialed to.
+func (r *Registry) Upstream() string {
+	r.upstreamMu.RLock()
+	defer r.upstreamMu.RUnlock()
+	return r.upstream
+}
+
+// SetUpstream hot-swaps the upstream address used for connections accepted
+// from now on; it does not affect connections already registered.
+func (r *Registry) SetUpstream(addr string) {
+	r.upstreamMu.Lock()
+	defer r.upstreamMu.Unlock()
+	r.upstream = addr
+}
+
+// ConnectionInfo is the JSON shape returned for each connection by the
+// admin API's list endpoint.
+type ConnectionInfo struct {
+	ID       string `json:"id"`
+	Sent     uint64 `json:"sent_bytes"`
+	Received uint64 `json:"received_bytes"`
+}
+
+// List returns a snapshot of every registered connection's ID and byte
+// counts.
+func (r *Registry) List() []ConnectionInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]ConnectionInfo, 0, len(r.conns))
+	for id, p := range r.conns {
+		sent, received := p.Stats()
+		out = append(out, ConnectionInfo{ID: id, Sent: sent, Received: received})
+	}
+	return out
+}
+
+// AdminAPI is a small HTTP/JSON control plane over a Registry: list
+// connections, tail byte counts, force-close a connection, hot-swap the
+// matcher/replacer/rules of a live connection, and hot-swap the upstream
+// used for new connections.
+//
+// TODO(chunk0-4 sign-off): the request that added this asked for "a small
+// gRPC service (with a JSON/HTTP gateway)". This ships the JSON/HTTP side
+// only - there is no gRPC service and no generated gateway - because a
+// protobuf/gRPC toolchain isn't available to build this repo. That's a real
+// reduction in scope from what was asked for, not an equivalent substitute,
+// and it has not been signed off by whoever filed the request. Needs an
+// explicit decision before this is considered done: either get sign-off that
+// JSON/HTTP-only is acceptable, or revisit once protoc/grpc-go can be
+// vendored and add the gRPC service (with this HTTP API kept or regenerated
+// as its gateway).
+type AdminAPI struct {
+	// matchCount numbers matches across every connection's handleMatch
+	// matcher, similar to RuleEngine.matchCount; incremented via
+	// sync/atomic since matchers for different connections can run
+	// concurrently. First in the struct so it stays 64-bit aligned on
+	// 32-bit platforms, per the sync/atomic docs.
+	matchCount uint64
+
+	Registry *Registry
+	Log      Logger
+}
+
+// NewAdminAPI builds an AdminAPI backed by reg.
+func NewAdminAPI(reg *Registry) *AdminAPI {
+	return &AdminAPI{Registry: reg, Log: NullLogger{}}
+}
+
+// Handler returns the http.Handler to serve, e.g. via http.ListenAndServe.
+func (a *AdminAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connections", a.handleList)
+	mux.HandleFunc("/connections/close", a.handleClose)
+	mux.HandleFunc("/connections/match", a.handleMatch)
+	mux.HandleFunc("/connections/replace", a.handleReplace)
+	mux.HandleFunc("/connections/rules", a.handleRules)
+	mux.HandleFunc("/upstream", a.handleUpstream)
+	return mux
+}
+
+func (a *AdminAPI) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.Registry.List())
+}
+
+type closeRequest struct {
+	ID string `json:"id"`
+}
+
+func (a *AdminAPI) handleClose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req closeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	p, ok := a.Registry.Get(req.ID)
+	if !ok {
+		http.Error(w, "unknown connection id", http.StatusNotFound)
+		return
+	}
+	p.Close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type matchRequest struct {
+	ID    string `json:"id"`
+	Match string `json:"match"`
+}
+
+// handleMatch hot-swaps the connection's Matcher to log matches of a new
+// regex, via Proxy.SetMatcher.
+func (a *AdminAPI) handleMatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req matchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	p, ok := a.Registry.Get(req.ID)
+	if !ok {
+		http.Error(w, "unknown connection id", http.StatusNotFound)
+		return
+	}
+
+	re, err := regexp.Compile(req.Match)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid match regex: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	p.SetMatcher(func(input []byte) {
+		ms := re.FindAll(input, -1)
+		for _, m := range ms {
+			n := atomic.AddUint64(&a.matchCount, 1)
+			a.Log.Info("Match #%d [conn=%s]: %s", n, req.ID, string(m))
+		}
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type replaceRequest struct {
+	ID      string `json:"id"`
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// handleReplace hot-swaps the connection's find/replace regex. It updates
+// both the whole-buffer Replacer (via Proxy.SetReplacer, for connections
+// that started with no -replace/-binreplace flag at all) and the streaming
+// ReplaceConfig (via Proxy.SetReplaceConfig, for connections that already
+// have a live per-direction ReplaceWriter) so the swap takes effect
+// regardless of which one the connection happens to be using - only one of
+// the two is ever consulted per connection, decided in Proxy.pipe.
+func (a *AdminAPI) handleReplace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req replaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	p, ok := a.Registry.Get(req.ID)
+	if !ok {
+		http.Error(w, "unknown connection id", http.StatusNotFound)
+		return
+	}
+
+	re, err := regexp.Compile(req.Match)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid match regex: %s", err), http.StatusBadRequest)
+		return
+	}
+	repl := []byte(req.Replace)
+
+	p.SetReplacer(func(input []byte) []byte {
+		return re.ReplaceAll(input, repl)
+	})
+	p.SetReplaceConfig(nil, nil, re, repl, 0)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type rulesRequest struct {
+	ID   string `json:"id"`
+	YAML string `json:"yaml"`
+}
+
+// handleRules hot-swaps the connection's RuleEngine, parsing the request
+// body's YAML the same way -rules does at startup (see ParseRuleEngine), via
+// Proxy.SetRules.
+func (a *AdminAPI) handleRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading request body: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var req rulesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	p, ok := a.Registry.Get(req.ID)
+	if !ok {
+		http.Error(w, "unknown connection id", http.StatusNotFound)
+		return
+	}
+
+	re, err := ParseRuleEngine([]byte(req.YAML))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid rules: %s", err), http.StatusBadRequest)
+		return
+	}
+	re.Log = a.Log
+
+	p.SetRules(re)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type upstreamRequest struct {
+	Addr string `json:"addr"`
+}
+
+func (a *AdminAPI) handleUpstream(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, upstreamRequest{Addr: a.Registry.Upstream()})
+	case http.MethodPost:
+		var req upstreamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+			return
+		}
+		a.Registry.SetUpstream(req.Addr)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestAdminAPI() (*AdminAPI, *Proxy) {
+	reg := NewRegistry("default:80")
+	p := &Proxy{Log: NullLogger{}, errsig: make(chan bool, 1)}
+	reg.Add("conn-1", p)
+
+	api := NewAdminAPI(reg)
+	api.Log = NullLogger{}
+	return api, p
+}
+
+func doRequest(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminAPI_HandleList(t *testing.T) {
+	api, _ := newTestAdminAPI()
+	rec := doRequest(t, api.Handler(), http.MethodGet, "/connections", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte(`"conn-1"`)) {
+		t.Fatalf("body %q missing registered connection", rec.Body.String())
+	}
+}
+
+func TestAdminAPI_HandleList_WrongMethod(t *testing.T) {
+	api, _ := newTestAdminAPI()
+	rec := doRequest(t, api.Handler(), http.MethodPost, "/connections", "")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", rec.Code)
+	}
+}
+
+func TestAdminAPI_HandleClose(t *testing.T) {
+	api, p := newTestAdminAPI()
+	rec := doRequest(t, api.Handler(), http.MethodPost, "/connections/close", `{"id":"conn-1"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rec.Code)
+	}
+	select {
+	case <-p.errsig:
+	default:
+		t.Fatalf("Close did not signal p.errsig")
+	}
+}
+
+func TestAdminAPI_HandleClose_UnknownID(t *testing.T) {
+	api, _ := newTestAdminAPI()
+	rec := doRequest(t, api.Handler(), http.MethodPost, "/connections/close", `{"id":"no-such-conn"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminAPI_HandleMatch(t *testing.T) {
+	api, p := newTestAdminAPI()
+	rec := doRequest(t, api.Handler(), http.MethodPost, "/connections/match", `{"id":"conn-1","match":"sec\\w+"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+	}
+
+	matcher, _, _ := p.snapshot()
+	if matcher == nil {
+		t.Fatalf("SetMatcher was not wired up by handleMatch")
+	}
+	// matcher logs via a.Log (a NullLogger here) and bumps AdminAPI's
+	// matchCount; this test only confirms it runs clean.
+	matcher([]byte("secret"))
+}
+
+func TestAdminAPI_HandleMatch_InvalidRegex(t *testing.T) {
+	api, _ := newTestAdminAPI()
+	rec := doRequest(t, api.Handler(), http.MethodPost, "/connections/match", `{"id":"conn-1","match":"("}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdminAPI_HandleReplace(t *testing.T) {
+	api, p := newTestAdminAPI()
+	rec := doRequest(t, api.Handler(), http.MethodPost, "/connections/replace",
+		`{"id":"conn-1","match":"secret","replace":"REDACTED"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+	}
+
+	_, replacer, _ := p.snapshot()
+	if replacer == nil {
+		t.Fatalf("SetReplacer was not wired up by handleReplace")
+	}
+	if got := string(replacer([]byte("this is secret"))); got != "this is REDACTED" {
+		t.Fatalf("replacer output %q, want this is REDACTED", got)
+	}
+	if p.ReplaceConfig == nil {
+		t.Fatalf("SetReplaceConfig was not wired up by handleReplace")
+	}
+}
+
+func TestAdminAPI_HandleRules(t *testing.T) {
+	api, p := newTestAdminAPI()
+	body := `{"id":"conn-1","yaml":"rules:\n  - name: block\n    match-contains: bad\n    actions:\n      - type: drop\n"}`
+	rec := doRequest(t, api.Handler(), http.MethodPost, "/connections/rules", body)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+	}
+
+	_, _, rules := p.snapshot()
+	if rules == nil {
+		t.Fatalf("SetRules was not wired up by handleRules")
+	}
+	if len(rules.Rules) != 1 || rules.Rules[0].Name != "block" {
+		t.Fatalf("unexpected rules: %+v", rules.Rules)
+	}
+}
+
+func TestAdminAPI_HandleRules_InvalidYAML(t *testing.T) {
+	api, _ := newTestAdminAPI()
+	body := `{"id":"conn-1","yaml":"rules:\n  - match-contains: bad\n"}`
+	rec := doRequest(t, api.Handler(), http.MethodPost, "/connections/rules", body)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 for a rule missing its required name", rec.Code)
+	}
+}
+
+func TestAdminAPI_HandleUpstream(t *testing.T) {
+	api, _ := newTestAdminAPI()
+
+	rec := doRequest(t, api.Handler(), http.MethodGet, "/upstream", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte("default:80")) {
+		t.Fatalf("body %q missing the default upstream", rec.Body.String())
+	}
+
+	rec = doRequest(t, api.Handler(), http.MethodPost, "/upstream", `{"addr":"new:9090"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rec.Code)
+	}
+
+	rec = doRequest(t, api.Handler(), http.MethodGet, "/upstream", "")
+	if !bytes.Contains(rec.Body.Bytes(), []byte("new:9090")) {
+		t.Fatalf("upstream not hot-swapped: body %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	proxy "github.com/sanderzegers/go-tcp-proxy"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// runConfig runs -config mode: many proxy front-ends in one process, as
+// described by a config.yaml "listen" list, until Ctrl-C.
+func runConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var cfg proxy.Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parsing config file: %w", err)
+	}
+
+	verbose := cfg.Verbose >= 1
+	veryVerbose := cfg.Verbose >= 2
+
+	configLogger := proxy.ColorLogger{Verbose: verbose, VeryVerbose: veryVerbose, Color: *colors}
+
+	var targets []proxy.Target
+	seen := make(map[string]bool)
+	for _, entry := range cfg.Listen {
+		expanded, err := proxy.ExpandListenEntry(entry)
+		if err != nil {
+			return fmt.Errorf("expanding listen entry for %q: %w", entry.TargetHost, err)
+		}
+		for _, t := range expanded {
+			if seen[t.Listen] {
+				return fmt.Errorf("duplicate listen address %q", t.Listen)
+			}
+			seen[t.Listen] = true
+		}
+		targets = append(targets, expanded...)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		connPrefix := fmt.Sprintf("Listener #%03d ", i+1)
+		listenerLog := proxy.ColorLogger{Verbose: verbose, VeryVerbose: veryVerbose, Color: *colors, Prefix: connPrefix}
+
+		var listenerConnID uint64
+		l := &proxy.Listener{
+			Target: target,
+			Log:    listenerLog,
+			NewProxy: func(conn *net.TCPConn, laddr, raddr *net.TCPAddr, id string) *proxy.Proxy {
+				n := atomic.AddUint64(&listenerConnID, 1)
+				p := proxy.New(conn, laddr, raddr)
+				p.Log = proxy.ColorLogger{
+					Verbose:     verbose,
+					VeryVerbose: veryVerbose,
+					Color:       *colors,
+					Prefix:      fmt.Sprintf("%sConnection #%03d [id=%s] ", connPrefix, n, id),
+				}
+				return p
+			},
+		}
+
+		wg.Add(1)
+		go func(l *proxy.Listener) {
+			defer wg.Done()
+			if err := l.Start(ctx); err != nil {
+				configLogger.Warn("Listener %s failed: %s", l.Target.Listen, err)
+			}
+		}(l)
+	}
+
+	configLogger.Info("Running %d listener(s) from %s, Ctrl-C to stop", len(targets), path)
+	wg.Wait()
+	return nil
+}
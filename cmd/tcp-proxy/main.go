@@ -1,15 +1,16 @@
 package main
 
 import (
-	"bytes"
 	hx "encoding/hex"
 	"flag"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"regexp"
 	"strings"
 
+	"github.com/google/uuid"
 	proxy "github.com/sanderzegers/go-tcp-proxy"
 )
 
@@ -30,11 +31,25 @@ var (
 	match       = flag.String("match", "", "match regex (in the form 'regex')")
 	replace     = flag.String("replace", "", "replace regex (in the form 'regex~replacer')")
 	binReplace  = flag.String("binreplace", "", "replace binary (in the form '20a4f3~20a500)")
+	rulesFile   = flag.String("rules", "", "path to a rules.yaml file (subsumes -match/-replace/-binreplace)")
+	replaceWin  = flag.Int("replace-window", proxy.DefaultReplaceWindow, "bytes of lookback held back per chunk so a -replace match spanning reads is still caught")
+	configFile  = flag.String("config", "", "path to a config.yaml file running many proxy front-ends at once (replaces -l/-r)")
+	routeFile   = flag.String("route", "", "path to a routes.yaml file mapping sniffed hostnames to upstreams")
+	sniff       = flag.String("sniff", "tls", "protocol to sniff for routing when -route is set ('tls' or 'http')")
+	apiAddr     = flag.String("api", "", "address for an admin HTTP/JSON API, e.g. ':7000' (disabled by default)")
 )
 
 func main() {
 	flag.Parse()
 
+	if *configFile != "" {
+		if err := runConfig(*configFile); err != nil {
+			logger.Warn("%s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logger := proxy.ColorLogger{
 		Verbose: *verbose,
 		Color:   *colors,
@@ -58,9 +73,58 @@ func main() {
 		os.Exit(1)
 	}
 
-	matcher := createMatcher(*match)
-	replacer := createReplacer(*replace)
-	binReplacer := createBinReplacer(*binReplace)
+	var matcher func([]byte)
+	var replaceConfig *proxy.ReplaceWriter
+	var rules *proxy.RuleEngine
+
+	if *rulesFile != "" {
+		var err error
+		rules, err = proxy.LoadRuleEngine(*rulesFile)
+		if err != nil {
+			logger.Warn("Failed to load rules file: %s", err)
+			os.Exit(1)
+		}
+		logger.Info("Loaded %d rule(s) from %s", len(rules.Rules), *rulesFile)
+	} else {
+		matcher = createMatcher(*match)
+		replaceConfig = createReplacer(*replace)
+		if *binReplace != "" {
+			replaceConfig = createBinReplacer(*binReplace)
+		}
+	}
+
+	var router *proxy.Router
+	var sniffer proxy.Sniffer
+	if *routeFile != "" {
+		router, err = proxy.LoadRouter(*routeFile)
+		if err != nil {
+			logger.Warn("Failed to load routes file: %s", err)
+			os.Exit(1)
+		}
+		switch *sniff {
+		case "http":
+			sniffer = proxy.HTTPSniffer{}
+		case "tls":
+			sniffer = proxy.TLSSniffer{}
+		default:
+			logger.Warn("Unknown -sniff protocol %q", *sniff)
+			os.Exit(1)
+		}
+		logger.Info("Routing by sniffed %s Host, default upstream %s", *sniff, router.Default)
+	}
+
+	var registry *proxy.Registry
+	if *apiAddr != "" {
+		registry = proxy.NewRegistry(*remoteAddr)
+		api := proxy.NewAdminAPI(registry)
+		api.Log = logger
+		go func() {
+			logger.Info("Admin API listening on %s", *apiAddr)
+			if err := http.ListenAndServe(*apiAddr, api.Handler()); err != nil {
+				logger.Warn("Admin API stopped: %s", err)
+			}
+		}()
+	}
 
 	if *veryverbose {
 		*verbose = true
@@ -74,21 +138,40 @@ func main() {
 		}
 		connid++
 
+		connRaddr := raddr
+		if registry != nil && router == nil {
+			connRaddr, err = net.ResolveTCPAddr("tcp", registry.Upstream())
+			if err != nil {
+				logger.Warn("Failed to resolve current upstream %q: %s", registry.Upstream(), err)
+				conn.Close()
+				continue
+			}
+		}
+
 		var p *proxy.Proxy
-		if *unwrapTLS {
+		switch {
+		case router != nil:
+			wrapped, host := proxy.Route(conn, sniffer, *remoteAddr, proxy.SniffTimeout)
+			target := router.Resolve(host)
+			upstream, err := net.ResolveTCPAddr("tcp", target)
+			if err != nil {
+				logger.Warn("Failed to resolve routed upstream %q: %s", target, err)
+				conn.Close()
+				continue
+			}
+			logger.Info("Routing connection #%03d to %s (sniffed %q)", connid, target, host)
+			p = proxy.NewFromConn(wrapped, laddr, upstream)
+		case *unwrapTLS:
 			logger.Info("Unwrapping TLS")
-			p = proxy.NewTLSUnwrapped(conn, laddr, raddr, *remoteAddr)
-		} else {
-			p = proxy.New(conn, laddr, raddr)
+			p = proxy.NewTLSUnwrapped(conn, laddr, connRaddr, *remoteAddr)
+		default:
+			p = proxy.New(conn, laddr, connRaddr)
 		}
 
+		p.ID = uuid.NewString()
 		p.Matcher = matcher
-		switch {
-		case *replace != "":
-			p.Replacer = replacer
-		case *binReplace != "":
-			p.Replacer = binReplacer
-		}
+		p.ReplaceConfig = replaceConfig
+		p.Rules = rules
 
 		p.Nagles = *nagles
 		p.OutputHex = *hex
@@ -99,7 +182,15 @@ func main() {
 			Color:       *colors,
 		}
 
-		go p.Start()
+		if registry != nil {
+			registry.Add(p.ID, p)
+			go func(id string) {
+				p.Start()
+				registry.Remove(id)
+			}(p.ID)
+		} else {
+			go p.Start()
+		}
 	}
 }
 
@@ -123,7 +214,7 @@ func createMatcher(match string) func([]byte) {
 	}
 }
 
-func createReplacer(replace string) func([]byte) []byte {
+func createReplacer(replace string) *proxy.ReplaceWriter {
 	if replace == "" {
 		return nil
 	}
@@ -143,12 +234,14 @@ func createReplacer(replace string) func([]byte) []byte {
 	repl := []byte(parts[1])
 
 	logger.Info("Replacing %s with %s", re.String(), repl)
-	return func(input []byte) []byte {
-		return re.ReplaceAll(input, repl)
+	return &proxy.ReplaceWriter{
+		Re:        re,
+		ReplRegex: repl,
+		Window:    *replaceWin,
 	}
 }
 
-func createBinReplacer(replace string) func([]byte) []byte {
+func createBinReplacer(replace string) *proxy.ReplaceWriter {
 	if replace == "" {
 		return nil
 	}
@@ -159,44 +252,21 @@ func createBinReplacer(replace string) func([]byte) []byte {
 		return nil
 	}
 
-	part := make([][]byte, 2)
-	var err error
-
-	part[0], err = hx.DecodeString(stringParts[0])
-
+	needle, err := hx.DecodeString(stringParts[0])
 	if err != nil {
 		logger.Warn("Invalid createBinReplacer 1st argument", err)
 		return nil
 	}
 
-	part[1], err = hx.DecodeString(stringParts[1])
-
+	repl, err := hx.DecodeString(stringParts[1])
 	if err != nil {
 		logger.Warn("Invalid createBinReplacer 2nd argument", err)
 		return nil
 	}
 
 	logger.Info("Binary Replacing %s with %s", stringParts[0], stringParts[1])
-	return func(input []byte) []byte {
-		var result []byte
-		start := 0
-		for {
-			// Find the next occurrence of the search pattern
-			index := bytes.Index(input[start:], part[0])
-			if index == -1 {
-				break
-			}
-
-			// Append the part before the match and the replacement
-			result = append(result, input[start:start+index]...)
-			result = append(result, part[1]...)
-
-			// Move the start position past the matched segment
-			start += index + len(part[0])
-		}
-
-		// Append the remaining part of the array
-		result = append(result, input[start:]...)
-		return result
+	return &proxy.ReplaceWriter{
+		Needle:      needle,
+		Replacement: repl,
 	}
 }
@@ -0,0 +1,56 @@
+package proxy
+
+import "fmt"
+
+const (
+	clrRed    = 31
+	clrGreen  = 32
+	clrYellow = 33
+	clrBlue   = 34
+	clrPurple = 35
+)
+
+// NullLogger - No logging.
+type NullLogger struct{}
+
+func (l NullLogger) Trace(format string, args ...interface{}) {}
+func (l NullLogger) Debug(format string, args ...interface{}) {}
+func (l NullLogger) Info(format string, args ...interface{})  {}
+func (l NullLogger) Warn(format string, args ...interface{})  {}
+
+// ColorLogger - Logs messages to stdout, optionally colorized, gated by
+// Verbose/VeryVerbose level and prefixed per connection.
+type ColorLogger struct {
+	Verbose     bool
+	VeryVerbose bool
+	Color       bool
+	Prefix      string
+}
+
+func (l ColorLogger) output(color int, msg string) {
+	if l.Color {
+		fmt.Printf("\033[1;%dm%s%s\033[0m\n", color, l.Prefix, msg)
+	} else {
+		fmt.Printf("%s%s\n", l.Prefix, msg)
+	}
+}
+
+func (l ColorLogger) Trace(format string, args ...interface{}) {
+	if l.VeryVerbose {
+		l.output(clrPurple, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l ColorLogger) Debug(format string, args ...interface{}) {
+	if l.Verbose {
+		l.output(clrYellow, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l ColorLogger) Info(format string, args ...interface{}) {
+	l.output(clrGreen, fmt.Sprintf(format, args...))
+}
+
+func (l ColorLogger) Warn(format string, args ...interface{}) {
+	l.output(clrBlue, fmt.Sprintf(format, args...))
+}
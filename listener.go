@@ -0,0 +1,276 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxExpandedHosts caps how many concrete hosts a single listen entry may
+// expand to, so a typo like a 10.0.0.0/8 range can't try to bind millions
+// of listeners.
+const maxExpandedHosts = 4096
+
+// Target is one concrete upstream/listen pair produced by expanding a
+// ListenEntry's target_host (and any hostname list) into individual hosts.
+type Target struct {
+	Addr   string // upstream host:port
+	Listen string // local host:port to listen on
+}
+
+// ListenEntry is one entry of a -config config.yaml file's top-level
+// "listen" list.
+type ListenEntry struct {
+	TargetHost string `yaml:"target_host"`
+	TargetPort int    `yaml:"target_port"`
+	ListenHost string `yaml:"listen_host"`
+	ListenPort int    `yaml:"listen_port"`
+}
+
+// Config is the top-level shape of a -config config.yaml file.
+type Config struct {
+	Verbose int           `yaml:"verbose"`
+	Listen  []ListenEntry `yaml:"listen"`
+}
+
+// Listener owns one accept loop for a single expanded Target, forwarding
+// accepted connections through a new Proxy per connection.
+type Listener struct {
+	Target Target
+	Log    Logger
+
+	// NewProxy builds the Proxy for a freshly accepted connection, already
+	// carrying its connection ID; exposed so callers can attach a
+	// Matcher/Replacer/RuleEngine before Start.
+	NewProxy func(conn *net.TCPConn, laddr, raddr *net.TCPAddr, id string) *Proxy
+
+	ln *net.TCPListener
+}
+
+// Start resolves the Target, binds the local listener and runs the accept
+// loop until ctx is cancelled or Close is called.
+func (l *Listener) Start(ctx context.Context) error {
+	laddr, err := net.ResolveTCPAddr("tcp", l.Target.Listen)
+	if err != nil {
+		return fmt.Errorf("resolving listen address %q: %w", l.Target.Listen, err)
+	}
+	raddr, err := net.ResolveTCPAddr("tcp", l.Target.Addr)
+	if err != nil {
+		return fmt.Errorf("resolving target address %q: %w", l.Target.Addr, err)
+	}
+
+	ln, err := net.ListenTCP("tcp", laddr)
+	if err != nil {
+		return fmt.Errorf("listening on %q: %w", l.Target.Listen, err)
+	}
+	l.ln = ln
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := ln.AcceptTCP()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			l.Log.Warn("Failed to accept connection on %s: %s", l.Target.Listen, err)
+			continue
+		}
+
+		id := uuid.NewString()
+		p := l.NewProxy(conn, laddr, raddr, id)
+		p.ID = id
+		go p.Start()
+	}
+}
+
+// Close stops the accept loop. Connections already proxying drain on their
+// own via Proxy.Start's normal error handling.
+func (l *Listener) Close() {
+	if l.ln != nil {
+		l.ln.Close()
+	}
+}
+
+// ExpandListenEntry turns one config listen entry into a list of concrete
+// Targets, auto-incrementing ListenPort per expanded host.
+func ExpandListenEntry(e ListenEntry) ([]Target, error) {
+	hosts, err := expandHosts(e.TargetHost)
+	if err != nil {
+		return nil, err
+	}
+
+	listenHost := e.ListenHost
+	targets := make([]Target, 0, len(hosts))
+	seen := make(map[string]bool, len(hosts))
+	for i, host := range hosts {
+		listenAddr := net.JoinHostPort(listenHost, strconv.Itoa(e.ListenPort+i))
+		if seen[listenAddr] {
+			return nil, fmt.Errorf("duplicate listen address %q", listenAddr)
+		}
+		seen[listenAddr] = true
+
+		targets = append(targets, Target{
+			Addr:   net.JoinHostPort(host, strconv.Itoa(e.TargetPort)),
+			Listen: listenAddr,
+		})
+	}
+	return targets, nil
+}
+
+// expandHosts expands a target_host value into concrete hosts: a single
+// hostname/IP, a dashed range "a.b.c.x-y", a CIDR block, or a comma
+// separated list of any of the above.
+func expandHosts(spec string) ([]string, error) {
+	var all []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var hosts []string
+		var err error
+		switch {
+		case strings.Contains(part, "/"):
+			hosts, err = expandCIDR(part)
+		case strings.Contains(part, "-") && isDashedIPRange(part):
+			hosts, err = expandDashedRange(part)
+		default:
+			hosts = []string{part}
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, hosts...)
+
+		if len(all) > maxExpandedHosts {
+			return nil, fmt.Errorf("target_host %q expands to more than %d hosts", spec, maxExpandedHosts)
+		}
+	}
+	return all, nil
+}
+
+func isDashedIPRange(s string) bool {
+	i := strings.LastIndex(s, ".")
+	if i == -1 {
+		return false
+	}
+	return strings.Contains(s[i+1:], "-")
+}
+
+// expandDashedRange expands "a.b.c.x-y" into the individual a.b.c.n hosts.
+func expandDashedRange(s string) ([]string, error) {
+	i := strings.LastIndex(s, ".")
+	if i == -1 {
+		return nil, fmt.Errorf("invalid host range %q", s)
+	}
+	prefix, lastOctet := s[:i], s[i+1:]
+
+	bounds := strings.SplitN(lastOctet, "-", 2)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid host range %q", s)
+	}
+
+	lo, err := parseOctet(bounds[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid host range %q: %w", s, err)
+	}
+	hi, err := parseOctet(bounds[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid host range %q: %w", s, err)
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("invalid host range %q: start %d is greater than end %d", s, lo, hi)
+	}
+	if hi-lo+1 > maxExpandedHosts {
+		return nil, fmt.Errorf("host range %q expands to more than %d hosts", s, maxExpandedHosts)
+	}
+
+	hosts := make([]string, 0, hi-lo+1)
+	for n := lo; n <= hi; n++ {
+		hosts = append(hosts, fmt.Sprintf("%s.%d", prefix, n))
+	}
+	return hosts, nil
+}
+
+func parseOctet(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if n < 0 || n > 255 {
+		return 0, fmt.Errorf("%d is out of range 0-255", n)
+	}
+	return n, nil
+}
+
+// expandCIDR expands a CIDR block into its usable hosts, skipping the
+// network and broadcast addresses for /24 or shorter.
+func expandCIDR(s string) ([]string, error) {
+	ip, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("CIDR %q is not an IPv4 range", s)
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	total := 1 << uint(bits-ones)
+	if total > maxExpandedHosts {
+		return nil, fmt.Errorf("CIDR %q expands to more than %d hosts", s, maxExpandedHosts)
+	}
+
+	skipEdges := ones <= 24
+
+	var hosts []string
+	for cur := cloneIP(ipnet.IP); ipnet.Contains(cur); incIP(cur) {
+		if skipEdges && (cur.Equal(ipnet.IP) || isBroadcast(cur, ipnet)) {
+			continue
+		}
+		hosts = append(hosts, cur.String())
+	}
+	// The incIP loop above already walks hosts in ascending numeric order;
+	// sorting them (previously done here with sort.Strings) re-orders them
+	// lexicographically instead (".1, .10, .100, ..., .11, ..." for a /24),
+	// which scrambled the listen_port assignment in ExpandListenEntry
+	// relative to host IP. No sort needed.
+	return hosts, nil
+}
+
+func cloneIP(ip net.IP) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	return out
+}
+
+func incIP(ip net.IP) {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+		if ip[i] != 0 {
+			return
+		}
+	}
+}
+
+func isBroadcast(ip net.IP, ipnet *net.IPNet) bool {
+	broadcast := cloneIP(ipnet.IP)
+	for i := range broadcast {
+		broadcast[i] |= ^ipnet.Mask[i]
+	}
+	return ip.Equal(broadcast)
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestExpandCIDR_AscendingOrder guards against regressing to the bug where
+// a trailing sort.Strings re-ordered the already-correctly-ordered hosts
+// lexicographically (".1, .10, .100, ..., .11, ...") instead of numerically,
+// which scrambled ExpandListenEntry's per-host listen_port assignment.
+func TestExpandCIDR_AscendingOrder(t *testing.T) {
+	hosts, err := expandCIDR("10.0.1.0/24")
+	if err != nil {
+		t.Fatalf("expandCIDR: %s", err)
+	}
+	if len(hosts) != 254 {
+		t.Fatalf("got %d hosts, want 254 (network/broadcast skipped)", len(hosts))
+	}
+	if hosts[0] != "10.0.1.1" || hosts[1] != "10.0.1.2" || hosts[2] != "10.0.1.3" {
+		t.Fatalf("hosts not in ascending numeric order: %v", hosts[:3])
+	}
+	if hosts[len(hosts)-1] != "10.0.1.254" {
+		t.Fatalf("last host = %q, want 10.0.1.254", hosts[len(hosts)-1])
+	}
+}
+
+// TestExpandCIDR_SkipsNetworkAndBroadcast covers the ones<=24 (/24 or
+// wider) edge skipping that expandCIDR documents.
+func TestExpandCIDR_SkipsNetworkAndBroadcast(t *testing.T) {
+	hosts, err := expandCIDR("192.168.5.0/24")
+	if err != nil {
+		t.Fatalf("expandCIDR: %s", err)
+	}
+	if len(hosts) != 254 {
+		t.Fatalf("got %d hosts, want 254", len(hosts))
+	}
+	if hosts[0] == "192.168.5.0" {
+		t.Fatalf("network address 192.168.5.0 not skipped")
+	}
+	if hosts[len(hosts)-1] == "192.168.5.255" {
+		t.Fatalf("broadcast address 192.168.5.255 not skipped")
+	}
+}
+
+// TestExpandCIDR_NonV24DoesNotSkipEdges covers the ones > 24 branch, where
+// skipEdges is false and every address in the block (including the block's
+// own network and broadcast addresses) is included.
+func TestExpandCIDR_NonV24DoesNotSkipEdges(t *testing.T) {
+	hosts, err := expandCIDR("10.0.2.0/25")
+	if err != nil {
+		t.Fatalf("expandCIDR: %s", err)
+	}
+	if len(hosts) != 128 {
+		t.Fatalf("got %d hosts, want 128 (no edge skipping for /25)", len(hosts))
+	}
+	if hosts[0] != "10.0.2.0" {
+		t.Fatalf("hosts[0] = %q, want 10.0.2.0 (network address not skipped for /25)", hosts[0])
+	}
+	if hosts[len(hosts)-1] != "10.0.2.127" {
+		t.Fatalf("last host = %q, want 10.0.2.127", hosts[len(hosts)-1])
+	}
+}
+
+func TestExpandCIDR_RejectsOversizedBlock(t *testing.T) {
+	if _, err := expandCIDR("10.0.0.0/16"); err == nil {
+		t.Fatalf("expected an error for a /16 (65536 hosts), over maxExpandedHosts")
+	}
+}
+
+func TestExpandCIDR_RejectsIPv6(t *testing.T) {
+	if _, err := expandCIDR("2001:db8::/120"); err == nil {
+		t.Fatalf("expected an error for an IPv6 CIDR")
+	}
+}
+
+func TestExpandDashedRange(t *testing.T) {
+	hosts, err := expandDashedRange("10.0.1.5-8")
+	if err != nil {
+		t.Fatalf("expandDashedRange: %s", err)
+	}
+	want := []string{"10.0.1.5", "10.0.1.6", "10.0.1.7", "10.0.1.8"}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("got %v, want %v", hosts, want)
+	}
+}
+
+func TestExpandDashedRange_InvertedRejected(t *testing.T) {
+	if _, err := expandDashedRange("10.0.1.8-5"); err == nil {
+		t.Fatalf("expected an error for an inverted range (start > end)")
+	}
+}
+
+func TestExpandDashedRange_FullOctetAccepted(t *testing.T) {
+	if _, err := expandDashedRange("10.0.1.0-255"); err != nil {
+		t.Fatalf("0-255 is exactly 256 hosts, within bounds: %s", err)
+	}
+}
+
+func TestParseOctet_Bounds(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr bool
+	}{
+		{"0", false},
+		{"255", false},
+		{"-1", true},
+		{"256", true},
+		{"notanumber", true},
+		{" 10 ", false},
+	}
+	for _, c := range cases {
+		_, err := parseOctet(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseOctet(%q) error = %v, wantErr %v", c.in, err, c.wantErr)
+		}
+	}
+}
+
+// TestExpandHosts_CommaSeparatedMix covers a spec combining a plain
+// hostname, a dashed range and a CIDR in one target_host value. The /30 is
+// narrower than ones<=24, so expandCIDR includes all 4 of its addresses
+// (no network/broadcast skipping).
+func TestExpandHosts_CommaSeparatedMix(t *testing.T) {
+	hosts, err := expandHosts("example.com, 10.0.1.2-3, 10.0.2.0/30")
+	if err != nil {
+		t.Fatalf("expandHosts: %s", err)
+	}
+	want := []string{"example.com", "10.0.1.2", "10.0.1.3", "10.0.2.0", "10.0.2.1", "10.0.2.2", "10.0.2.3"}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("got %v, want %v", hosts, want)
+	}
+}
+
+func TestExpandHosts_RejectsOverCap(t *testing.T) {
+	if _, err := expandHosts("10.0.0.0/16"); err == nil {
+		t.Fatalf("expected an error over maxExpandedHosts")
+	}
+}
+
+// TestExpandListenEntry_PortsFollowHostOrder guards the end-to-end
+// behavior the CIDR-ordering bug actually broke: listen_port must increase
+// in step with ascending host IP, not with whatever order hosts happened to
+// come back in.
+func TestExpandListenEntry_PortsFollowHostOrder(t *testing.T) {
+	targets, err := ExpandListenEntry(ListenEntry{
+		TargetHost: "10.0.1.0/30",
+		TargetPort: 80,
+		ListenHost: "0.0.0.0",
+		ListenPort: 9000,
+	})
+	if err != nil {
+		t.Fatalf("ExpandListenEntry: %s", err)
+	}
+	want := []Target{
+		{Addr: "10.0.1.0:80", Listen: "0.0.0.0:9000"},
+		{Addr: "10.0.1.1:80", Listen: "0.0.0.0:9001"},
+		{Addr: "10.0.1.2:80", Listen: "0.0.0.0:9002"},
+		{Addr: "10.0.1.3:80", Listen: "0.0.0.0:9003"},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Fatalf("got %+v, want %+v", targets, want)
+	}
+}
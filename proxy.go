@@ -0,0 +1,315 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"regexp"
+	"sync"
+)
+
+// Proxy - Manages a Proxy connection, piping data between local and remote.
+type Proxy struct {
+	// ID optionally correlates this connection across log lines and, when
+	// run under a multi-listener Listener, across process restarts.
+	ID string
+
+	sentBytes     uint64
+	receivedBytes uint64
+	laddr, raddr  *net.TCPAddr
+	lconn, rconn  io.ReadWriteCloser
+	erred         bool
+	errsig        chan bool
+	tlsUnwrapp    bool
+	tlsAddress    string
+
+	// rulesMu guards Matcher/Replacer/Rules/ReplaceConfig so the admin API
+	// can hot-swap them while pipe goroutines are running; every read/write
+	// of these fields after Start must go through the accessor methods
+	// below.
+	rulesMu  sync.RWMutex
+	Matcher  func([]byte)
+	Replacer func([]byte) []byte
+	Rules    *RuleEngine
+
+	// ReplaceConfig, if set, takes over from Replacer: each direction gets
+	// its own ReplaceWriter (built from this template) so a match
+	// straddling two reads is still caught. See replace_writer.go.
+	ReplaceConfig *ReplaceWriter
+
+	// liveReplaceWriters holds the per-direction ReplaceWriter instances
+	// pipe built from ReplaceConfig, so SetReplaceConfig can hot-swap their
+	// find/replace parameters in place (preserving each one's buffered
+	// tail) instead of only affecting connections that haven't started
+	// streaming yet.
+	liveReplaceWriters []*ReplaceWriter
+
+	Nagles    bool
+	Log       Logger
+	OutputHex bool
+}
+
+// SetMatcher atomically swaps the Matcher used by in-flight pipe goroutines.
+func (p *Proxy) SetMatcher(m func([]byte)) {
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+	p.Matcher = m
+}
+
+// SetReplacer atomically swaps the Replacer used by in-flight pipe goroutines.
+func (p *Proxy) SetReplacer(r func([]byte) []byte) {
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+	p.Replacer = r
+}
+
+// SetRules atomically swaps the RuleEngine used by in-flight pipe goroutines.
+func (p *Proxy) SetRules(re *RuleEngine) {
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+	p.Rules = re
+}
+
+// SetReplaceConfig hot-swaps the streaming find/replace parameters used by
+// this connection's ReplaceWriters. Unlike SetReplacer, this takes effect
+// even on connections that were started with -replace/-binreplace (i.e.
+// already have a non-nil ReplaceConfig and therefore a live, per-direction
+// ReplaceWriter): rather than only updating the template consulted by
+// newReplaceWriter at pipe-start, it pushes the new parameters into every
+// ReplaceWriter pipe has already built, preserving each one's buffered tail.
+func (p *Proxy) SetReplaceConfig(needle, replacement []byte, re *regexp.Regexp, replRegex []byte, window int) {
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+
+	p.ReplaceConfig = &ReplaceWriter{
+		Needle:      needle,
+		Replacement: replacement,
+		Re:          re,
+		ReplRegex:   replRegex,
+		Window:      window,
+	}
+	for _, rw := range p.liveReplaceWriters {
+		rw.SetConfig(needle, replacement, re, replRegex, window)
+	}
+}
+
+func (p *Proxy) snapshot() (func([]byte), func([]byte) []byte, *RuleEngine) {
+	p.rulesMu.RLock()
+	defer p.rulesMu.RUnlock()
+	return p.Matcher, p.Replacer, p.Rules
+}
+
+// Stats returns the running sent/received byte counts for this connection.
+func (p *Proxy) Stats() (sent, received uint64) {
+	return p.sentBytes, p.receivedBytes
+}
+
+// Close force-terminates the connection, as if the remote end had hung up.
+func (p *Proxy) Close() {
+	p.err("Closed by admin API\n", io.EOF)
+}
+
+// Logger - Interface for a proxy connection's logger.
+type Logger interface {
+	Trace(string, ...interface{})
+	Debug(string, ...interface{})
+	Info(string, ...interface{})
+	Warn(string, ...interface{})
+}
+
+// New - Create a new Proxy instance. Takes over local connection passed in,
+// and closes it when finished.
+func New(lconn *net.TCPConn, laddr, raddr *net.TCPAddr) *Proxy {
+	return NewFromConn(lconn, laddr, raddr)
+}
+
+// NewFromConn is like New, but accepts any io.ReadWriteCloser rather than a
+// concrete *net.TCPConn. It's used when the local connection has already
+// been wrapped, e.g. by Route to replay sniffed bytes transparently.
+func NewFromConn(lconn io.ReadWriteCloser, laddr, raddr *net.TCPAddr) *Proxy {
+	return &Proxy{
+		lconn:  lconn,
+		laddr:  laddr,
+		raddr:  raddr,
+		erred:  false,
+		errsig: make(chan bool),
+		Log:    NullLogger{},
+	}
+}
+
+// NewTLSUnwrapped - Create a new Proxy instance which dials the remote
+// address over TLS but exposes the decrypted stream locally.
+func NewTLSUnwrapped(lconn *net.TCPConn, laddr, raddr *net.TCPAddr, addr string) *Proxy {
+	p := New(lconn, laddr, raddr)
+	p.tlsUnwrapp = true
+	p.tlsAddress = addr
+	return p
+}
+
+func (p *Proxy) err(s string, err error) {
+	if p.erred {
+		return
+	}
+	if err != io.EOF {
+		p.Log.Warn(s, err)
+	}
+	p.errsig <- true
+	p.erred = true
+}
+
+// Start - open connection to remote and start proxying data.
+func (p *Proxy) Start() {
+	defer p.lconn.Close()
+
+	var err error
+	//connect to remote
+	if p.tlsUnwrapp {
+		p.rconn, err = tls.Dial("tcp", p.tlsAddress, nil)
+	} else {
+		p.rconn, err = net.DialTCP("tcp", nil, p.raddr)
+	}
+	if err != nil {
+		p.Log.Warn("Remote connection failed: %s", err)
+		return
+	}
+	defer p.rconn.Close()
+
+	//nagles?
+	if p.Nagles {
+		if conn, ok := p.lconn.(*net.TCPConn); ok {
+			conn.SetNoDelay(true)
+		}
+		if conn, ok := p.rconn.(*net.TCPConn); ok {
+			conn.SetNoDelay(true)
+		}
+	}
+
+	//display both ends
+	p.Log.Info("Opened %s >>> %s", p.laddr.String(), p.raddr.String())
+
+	//bidirectional copy
+	go p.pipe(p.lconn, p.rconn)
+	go p.pipe(p.rconn, p.lconn)
+
+	//wait for close...
+	<-p.errsig
+	p.Log.Info("Closed (%d bytes sent, %d bytes received)", p.sentBytes, p.receivedBytes)
+}
+
+// newReplaceWriter builds a per-direction ReplaceWriter from p.ReplaceConfig,
+// targeting dst, and registers it so SetReplaceConfig can hot-swap it later;
+// each direction's goroutine gets its own instance so the two streams'
+// rolling tails never mix.
+func (p *Proxy) newReplaceWriter(dst io.Writer) *ReplaceWriter {
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+
+	cfg := p.ReplaceConfig
+	if cfg == nil {
+		return nil
+	}
+	rw := &ReplaceWriter{
+		Dst:         dst,
+		Needle:      cfg.Needle,
+		Replacement: cfg.Replacement,
+		Re:          cfg.Re,
+		ReplRegex:   cfg.ReplRegex,
+		Window:      cfg.Window,
+	}
+	p.liveReplaceWriters = append(p.liveReplaceWriters, rw)
+	return rw
+}
+
+func (p *Proxy) pipe(src, dst io.ReadWriter) {
+	islocal := src == p.lconn
+
+	var dataDirection string
+	var ruleDirection Direction
+	if islocal {
+		dataDirection = ">>> %d bytes sent%s"
+		ruleDirection = ClientToServer
+	} else {
+		dataDirection = "<<< %d bytes received%s"
+		ruleDirection = ServerToClient
+	}
+
+	var byteFormat string
+	if p.OutputHex {
+		byteFormat = "%x"
+	} else {
+		byteFormat = "%s"
+	}
+
+	replaceWriter := p.newReplaceWriter(dst)
+
+	//directional copy (64k buffer)
+	buff := make([]byte, 0xffff)
+	for {
+		n, err := src.Read(buff)
+		if err != nil {
+			if replaceWriter != nil {
+				if ferr := replaceWriter.Flush(); ferr != nil {
+					p.err("Write failed '%s'\n", ferr)
+					return
+				}
+			}
+			p.err("Read failed '%s'\n", err)
+			return
+		}
+		b := buff[:n]
+
+		matcher, replacer, rules := p.snapshot()
+
+		closeAfterWrite := false
+
+		//execute rules, if configured, in place of Matcher/Replacer
+		if rules != nil {
+			// src, not dst: an "inject" action replies on the same side
+			// that sent the triggering data, not onward to the other end.
+			result := rules.Process(ruleDirection, b, src)
+			if result.Drop {
+				continue
+			}
+			b = result.Data
+			closeAfterWrite = result.Close
+		} else {
+			//execute match
+			if matcher != nil {
+				matcher(b)
+			}
+
+			//execute replace, preferring the streaming ReplaceWriter (it
+			//handles matches spanning reads) over the whole-buffer Replacer
+			if replaceWriter == nil && replacer != nil {
+				b = replacer(b)
+			}
+		}
+
+		//show output
+		p.Log.Debug(dataDirection, n, "")
+		p.Log.Trace(byteFormat, b)
+
+		//write out result
+		if replaceWriter != nil && rules == nil {
+			n, err = replaceWriter.Write(b)
+		} else {
+			n, err = dst.Write(b)
+		}
+		if err != nil {
+			p.err("Write failed '%s'\n", err)
+			return
+		}
+		if islocal {
+			p.sentBytes += uint64(n)
+		} else {
+			p.receivedBytes += uint64(n)
+		}
+
+		if closeAfterWrite {
+			// b (e.g. the output of a preceding "replace" action) must
+			// reach dst before the connection is torn down.
+			p.err("Closed by rule\n", io.EOF)
+			return
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// readAvailable drains conn until no more bytes arrive within timeout,
+// returning whatever was read. Proxy.pipe never closes its dst on EOF (the
+// caller owns that), so tests can't rely on io.EOF to know a stream is done.
+func readAvailable(t *testing.T, conn net.Conn, timeout time.Duration) []byte {
+	t.Helper()
+
+	var out []byte
+	buf := make([]byte, 256)
+	deadline := time.Now().Add(timeout)
+	for {
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		out = append(out, buf[:n]...)
+		if err != nil {
+			return out
+		}
+	}
+}
+
+// TestProxySetReplaceConfigHotSwapsLiveStream guards against regressing to
+// the bug where Proxy.pipe built each direction's ReplaceWriter once from
+// ReplaceConfig when the goroutine started and never consulted it again: a
+// connection started with -replace/-binreplace (i.e. ReplaceConfig already
+// non-nil) must still pick up a find/replace change made later via the
+// admin API, not just connections that started with no replace config at
+// all.
+func TestProxySetReplaceConfigHotSwapsLiveStream(t *testing.T) {
+	srcA, srcB := net.Pipe()
+	dstA, dstB := net.Pipe()
+	defer srcA.Close()
+	defer dstB.Close()
+
+	re := regexp.MustCompile(`session=\w+`)
+	p := &Proxy{
+		lconn:  srcB,
+		Log:    NullLogger{},
+		errsig: make(chan bool, 1),
+		ReplaceConfig: &ReplaceWriter{
+			Re:        re,
+			ReplRegex: []byte("session=OLD"),
+			Window:    8,
+		},
+	}
+	go p.pipe(srcB, dstA)
+
+	// Write enough data to push the ReplaceWriter's window-based flush, so
+	// the per-direction instance is actually constructed and running
+	// before the hot-swap below.
+	if _, err := srcA.Write([]byte("padding well past the window ")); err != nil {
+		t.Fatalf("write padding: %s", err)
+	}
+	readAvailable(t, dstB, time.Second)
+
+	p.SetReplaceConfig(nil, nil, re, []byte("session=NEW"), 8)
+
+	go func() {
+		srcA.Write([]byte("session=zzz"))
+		srcA.Close()
+	}()
+
+	out := readAvailable(t, dstB, time.Second)
+	if !bytes.Contains(out, []byte("session=NEW")) {
+		t.Fatalf("output %q missing post-swap replacement session=NEW", out)
+	}
+	if bytes.Contains(out, []byte("session=OLD")) {
+		t.Fatalf("output %q still used pre-swap replacement session=OLD", out)
+	}
+}
+
+// TestPipeRuleCloseStillWritesPrecedingData guards against regressing to the
+// bug where a matched "close" action made pipe return immediately, silently
+// dropping whatever a preceding "replace" action (or just the original
+// matched bytes) had produced in Result.Data - only "inject" actions (which
+// write straight to their target inside RuleEngine.Process) ever reached the
+// peer.
+func TestPipeRuleCloseStillWritesPrecedingData(t *testing.T) {
+	srcA, srcB := net.Pipe()
+	dstA, dstB := net.Pipe()
+	defer srcA.Close()
+	defer dstB.Close()
+
+	rule := &Rule{
+		Name:          "redact-and-close",
+		Direction:     Both,
+		matchContains: []byte("secret"),
+		Actions: []ruleAction{
+			{Type: "replace", replaceBytes: []byte("REDACTED")},
+			{Type: "close"},
+		},
+	}
+	p := &Proxy{
+		lconn:  srcB,
+		Log:    NullLogger{},
+		errsig: make(chan bool, 1),
+		Rules:  &RuleEngine{Rules: []*Rule{rule}, Log: NullLogger{}},
+	}
+	go p.pipe(srcB, dstA)
+
+	go srcA.Write([]byte("this has secret data"))
+
+	out := readAvailable(t, dstB, time.Second)
+	want := "this has REDACTED data"
+	if string(out) != want {
+		t.Fatalf("dst got %q, want %q (replaced data dropped on rule close)", out, want)
+	}
+}
+
+// TestPipeRuleInjectRepliesToSender guards against regressing to inject
+// writing onward to dst instead of back to whichever side sent the
+// triggering data: the request this implements describes inject as sending
+// "a canned response back on the same side", i.e. a reply to the sender, not
+// a second message forwarded to the other end.
+func TestPipeRuleInjectRepliesToSender(t *testing.T) {
+	srcA, srcB := net.Pipe()
+	dstA, dstB := net.Pipe()
+	defer srcA.Close()
+	defer dstB.Close()
+
+	rule := &Rule{
+		Name:          "ping-pong",
+		Direction:     Both,
+		matchContains: []byte("ping"),
+		Actions: []ruleAction{
+			{Type: "inject", injectBytes: []byte("pong")},
+		},
+	}
+	p := &Proxy{
+		lconn:  srcB,
+		Log:    NullLogger{},
+		errsig: make(chan bool, 1),
+		Rules:  &RuleEngine{Rules: []*Rule{rule}, Log: NullLogger{}},
+	}
+	go p.pipe(srcB, dstA)
+
+	go srcA.Write([]byte("ping"))
+
+	reply := readAvailable(t, srcA, time.Second)
+	if string(reply) != "pong" {
+		t.Fatalf("sender got %q, want the injected reply %q", reply, "pong")
+	}
+
+	forwarded := readAvailable(t, dstB, time.Second)
+	if string(forwarded) != "ping" {
+		t.Fatalf("dst got %q, want the untouched forwarded data %q", forwarded, "ping")
+	}
+}
@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// DefaultReplaceWindow is how many trailing bytes of a regex ReplaceWriter's
+// buffer are held back on each chunk, in case a match straddles the next
+// Write call. Override per-instance via ReplaceWriter.Window, or globally
+// at the command line with -replace-window.
+const DefaultReplaceWindow = 4 * 1024
+
+// ReplaceWriter wraps a destination io.Writer and performs a streaming
+// regex or binary find-and-replace across Write calls, so a match that
+// straddles two TCP segments (and therefore two Read/Write calls) is still
+// caught. A replace run once per buffer silently misses a needle split
+// across reads; ReplaceWriter instead keeps a rolling tail of unresolved
+// bytes and only flushes the prefix known not to be part of a match.
+type ReplaceWriter struct {
+	Dst io.Writer
+
+	// cfgMu guards the fields below so an admin API handler can hot-swap a
+	// live connection's find/replace config (see Proxy.SetReplaceConfig)
+	// while this instance's own goroutine is concurrently calling
+	// Write/Flush. tail is NOT covered by cfgMu: it's only ever touched by
+	// the single goroutine driving Write/Flush for this instance.
+	cfgMu sync.RWMutex
+
+	// Needle/Replacement configure a literal (binreplace-style) search;
+	// set these for a fixed-width needle.
+	Needle      []byte
+	Replacement []byte
+
+	// Re/ReplRegex configure a regex search instead; set these (and leave
+	// Needle nil) for regex mode. Window bounds how much of the rolling
+	// buffer is rescanned per chunk; it defaults to DefaultReplaceWindow.
+	Re        *regexp.Regexp
+	ReplRegex []byte
+	Window    int
+
+	tail []byte
+}
+
+// replaceConfig is an immutable snapshot of the fields SetConfig can hot-swap,
+// taken once per Write/Flush call so a concurrent SetConfig can't be
+// observed mid-splice.
+type replaceConfig struct {
+	needle, replacement []byte
+	re                  *regexp.Regexp
+	replRegex           []byte
+	window              int
+}
+
+func (w *ReplaceWriter) config() replaceConfig {
+	w.cfgMu.RLock()
+	defer w.cfgMu.RUnlock()
+	return replaceConfig{
+		needle:      w.Needle,
+		replacement: w.Replacement,
+		re:          w.Re,
+		replRegex:   w.ReplRegex,
+		window:      w.Window,
+	}
+}
+
+// SetConfig atomically swaps the find/replace parameters used by subsequent
+// Write/Flush calls, leaving any already-buffered tail (and therefore the
+// in-flight straddling-match detection) untouched. Pass nil for re to
+// switch to literal mode, or a non-nil re (leaving needle nil) for regex
+// mode, mirroring the Needle/Re fields themselves.
+func (w *ReplaceWriter) SetConfig(needle, replacement []byte, re *regexp.Regexp, replRegex []byte, window int) {
+	w.cfgMu.Lock()
+	defer w.cfgMu.Unlock()
+	w.Needle = needle
+	w.Replacement = replacement
+	w.Re = re
+	w.ReplRegex = replRegex
+	w.Window = window
+}
+
+// Write implements io.Writer, buffering a safe tail and flushing everything
+// before it downstream.
+func (w *ReplaceWriter) Write(p []byte) (int, error) {
+	buf := append(w.tail, p...)
+	w.tail = nil
+
+	cfg := w.config()
+
+	var flush, hold []byte
+	if cfg.re != nil {
+		flush, hold = spliceRegex(buf, cfg.re, cfg.replRegex, cfg.window)
+	} else {
+		flush, hold = spliceLiteral(buf, cfg.needle, cfg.replacement)
+	}
+
+	w.tail = append(w.tail[:0], hold...)
+
+	if len(flush) > 0 {
+		if _, err := w.Dst.Write(flush); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes out any remaining buffered tail, performing replacement on
+// it as a final, complete chunk. Call this once the source is exhausted
+// (e.g. on EOF) so the last few bytes of a stream aren't lost.
+func (w *ReplaceWriter) Flush() error {
+	if len(w.tail) == 0 {
+		return nil
+	}
+	cfg := w.config()
+
+	var out []byte
+	if cfg.re != nil {
+		out = cfg.re.ReplaceAll(w.tail, cfg.replRegex)
+	} else {
+		out = bytes.ReplaceAll(w.tail, cfg.needle, cfg.replacement)
+	}
+	w.tail = nil
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := w.Dst.Write(out)
+	return err
+}
+
+// spliceLiteral replaces every occurrence of needle in buf (bytes.Index only
+// ever reports complete matches) and returns the safely-flushable prefix
+// plus a suspect tail of at most len(needle)-1 bytes to carry over, so a
+// needle whose prefix lands at the very end of buf still has a chance to
+// complete once more bytes arrive. A match is only flushed once its whole
+// span - including the text after it up to the cutoff - is accounted for,
+// so a match straddling the cutoff is never split between this Write and
+// the next.
+func spliceLiteral(buf, needle, replacement []byte) (flush, hold []byte) {
+	holdLen := len(needle) - 1
+	if holdLen < 0 || len(buf) <= holdLen {
+		return nil, buf
+	}
+	cutoff := len(buf) - holdLen
+
+	pos := 0
+	for {
+		idx := bytes.Index(buf[pos:], needle)
+		if idx == -1 {
+			break
+		}
+		matchStart := pos + idx
+		flush = append(flush, buf[pos:matchStart]...)
+		flush = append(flush, replacement...)
+		pos = matchStart + len(needle)
+	}
+
+	if pos < cutoff {
+		flush = append(flush, buf[pos:cutoff]...)
+		pos = cutoff
+	}
+	return flush, buf[pos:]
+}
+
+// spliceRegex is the regex analogue of spliceLiteral, with one extra
+// subtlety: a match reported by FindAllIndex is only provably complete if
+// it ends strictly before len(buf). A match whose end coincides with
+// len(buf) may still be a prefix of a longer greedy match (e.g. `\w+`)
+// that would extend further given the bytes of the next Write, so it -
+// and the rest of the chunk from its start onward - must be held back
+// rather than flushed. window bounds how much unmatched tail is kept in
+// case it's the start of a match that completes once more bytes arrive,
+// and is also, implicitly, the longest match this ReplaceWriter can
+// promise to catch: a greedy pattern that would match more than window
+// bytes if read in one piece may be replaced early if it happens to end
+// strictly inside the current chunk regardless.
+func spliceRegex(buf []byte, re *regexp.Regexp, replRegex []byte, window int) (flush, hold []byte) {
+	if window <= 0 {
+		window = DefaultReplaceWindow
+	}
+	if len(buf) <= window {
+		return nil, buf
+	}
+	cutoff := len(buf) - window
+
+	matches := re.FindAllIndex(buf, -1)
+	pos := 0
+	holdFrom := cutoff
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if end >= len(buf) {
+			// Touches the buffer boundary: not provably complete, so this
+			// match and everything from its start onward must be held.
+			if start < holdFrom {
+				holdFrom = start
+			}
+			break
+		}
+		flush = append(flush, buf[pos:start]...)
+		flush = append(flush, replRegex...)
+		pos = end
+	}
+
+	if pos < holdFrom {
+		flush = append(flush, buf[pos:holdFrom]...)
+		pos = holdFrom
+	}
+	return flush, buf[pos:]
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func wholeBufferLiteral(payload, needle, replacement []byte) []byte {
+	return bytes.ReplaceAll(payload, needle, replacement)
+}
+
+func streamedLiteral(t *testing.T, payload, needle, replacement []byte, splits []int) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+	w := &ReplaceWriter{Dst: &out, Needle: needle, Replacement: replacement}
+
+	start := 0
+	for _, split := range splits {
+		if _, err := w.Write(payload[start:split]); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		start = split
+	}
+	if _, err := w.Write(payload[start:]); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %s", err)
+	}
+	return out.Bytes()
+}
+
+// TestReplaceWriterLiteral_EveryOffset feeds the same payload split at every
+// possible offset and asserts byte-identical output to the whole-buffer
+// bytes.ReplaceAll, so a needle straddling two Write calls is never missed.
+func TestReplaceWriterLiteral_EveryOffset(t *testing.T) {
+	payload := []byte("the quick brown fox jumps over the lazy dog, the quick brown fox again")
+	needle := []byte("quick brown fox")
+	replacement := []byte("REDACTED")
+
+	want := wholeBufferLiteral(payload, needle, replacement)
+
+	for split := 0; split <= len(payload); split++ {
+		got := streamedLiteral(t, payload, needle, replacement, []int{split})
+		if !bytes.Equal(got, want) {
+			t.Fatalf("split at %d: got %q, want %q", split, got, want)
+		}
+	}
+}
+
+func TestReplaceWriterLiteral_EveryPairOfOffsets(t *testing.T) {
+	payload := []byte("aaaneedleaaaneedleaaa")
+	needle := []byte("needle")
+	replacement := []byte("X")
+
+	want := wholeBufferLiteral(payload, needle, replacement)
+
+	for i := 0; i <= len(payload); i++ {
+		for j := i; j <= len(payload); j++ {
+			got := streamedLiteral(t, payload, needle, replacement, []int{i, j})
+			if !bytes.Equal(got, want) {
+				t.Fatalf("splits at %d,%d: got %q, want %q", i, j, got, want)
+			}
+		}
+	}
+}
+
+func TestReplaceWriterRegex_EveryOffset(t *testing.T) {
+	payload := []byte("user=alice session=abc123 user=bob session=def456")
+	re := regexp.MustCompile(`session=\w+`)
+	replacement := []byte("session=REDACTED")
+
+	want := re.ReplaceAll(payload, replacement)
+
+	for split := 0; split <= len(payload); split++ {
+		var out bytes.Buffer
+		w := &ReplaceWriter{Dst: &out, Re: re, ReplRegex: replacement, Window: 8}
+
+		if _, err := w.Write(payload[:split]); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		if _, err := w.Write(payload[split:]); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush: %s", err)
+		}
+
+		if got := out.Bytes(); !bytes.Equal(got, want) {
+			t.Fatalf("split at %d: got %q, want %q", split, got, want)
+		}
+	}
+}
+
+func TestReplaceWriterLiteral_NoMatch(t *testing.T) {
+	payload := []byte("nothing to see here")
+	needle := []byte("needle")
+	replacement := []byte("X")
+
+	got := streamedLiteral(t, payload, needle, replacement, []int{5, 12})
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("got %q, want unchanged %q", got, payload)
+	}
+}
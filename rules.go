@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync/atomic"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Direction identifies which side of the connection a chunk of data was
+// read from.
+type Direction string
+
+const (
+	// ClientToServer - data read from the client, about to be sent upstream.
+	ClientToServer Direction = "client->server"
+	// ServerToClient - data read from the upstream server, about to be sent
+	// back to the client.
+	ServerToClient Direction = "server->client"
+	// Both - matches either direction.
+	Both Direction = "both"
+)
+
+// ruleAction is a single action attached to a Rule, as loaded from YAML.
+type ruleAction struct {
+	Type string `yaml:"type"`
+
+	// replace
+	Replace string `yaml:"replace"`
+	Hex     bool   `yaml:"hex"`
+
+	// inject
+	Inject    string `yaml:"inject"`
+	InjectHex string `yaml:"inject-hex"`
+
+	replaceBytes []byte
+	injectBytes  []byte
+}
+
+// Rule is one entry of a rules.yaml file: a match condition (a match regex,
+// a match-contains literal, or both), a direction filter, and one or more
+// actions run in order when it matches. A rule with neither match nor
+// match-contains set never matches.
+type Rule struct {
+	Name          string       `yaml:"name"`
+	Match         string       `yaml:"match"`
+	MatchContains string       `yaml:"match-contains"`
+	Direction     Direction    `yaml:"direction"`
+	Actions       []ruleAction `yaml:"actions"`
+
+	re            *regexp.Regexp
+	matchContains []byte
+}
+
+// RuleEngine evaluates an ordered list of Rules against each chunk of data
+// flowing through a Proxy, in place of the older single Matcher/Replacer
+// functions.
+type RuleEngine struct {
+	// matchCount is incremented via sync/atomic: every direction of every
+	// connection sharing this RuleEngine calls Process concurrently. It's
+	// first in the struct so it stays 64-bit aligned on 32-bit platforms,
+	// per the sync/atomic docs.
+	matchCount uint64
+
+	Rules []*Rule
+	Log   Logger
+}
+
+// ruleFile is the top-level shape of a -rules rules.yaml document.
+type ruleFile struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// LoadRuleEngine reads and compiles a rules.yaml file.
+func LoadRuleEngine(path string) (*RuleEngine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rules file: %w", err)
+	}
+	return ParseRuleEngine(data)
+}
+
+// ParseRuleEngine compiles a rules.yaml document already in memory, e.g. one
+// received as the body of an admin API request rather than read from disk.
+func ParseRuleEngine(data []byte) (*RuleEngine, error) {
+	var doc ruleFile
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing rules file: %w", err)
+	}
+
+	for _, r := range doc.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule missing required name")
+		}
+		if r.Direction == "" {
+			r.Direction = Both
+		}
+		if r.Match != "" {
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid match regex: %w", r.Name, err)
+			}
+			r.re = re
+		}
+		if r.MatchContains != "" {
+			r.matchContains = []byte(r.MatchContains)
+		}
+		for i := range r.Actions {
+			a := &r.Actions[i]
+			switch a.Type {
+			case "replace":
+				if a.Hex {
+					b, err := hex.DecodeString(a.Replace)
+					if err != nil {
+						return nil, fmt.Errorf("rule %q: invalid hex replace: %w", r.Name, err)
+					}
+					a.replaceBytes = b
+				} else {
+					a.replaceBytes = []byte(a.Replace)
+				}
+			case "inject":
+				if a.InjectHex != "" {
+					b, err := hex.DecodeString(a.InjectHex)
+					if err != nil {
+						return nil, fmt.Errorf("rule %q: invalid inject-hex: %w", r.Name, err)
+					}
+					a.injectBytes = b
+				} else {
+					a.injectBytes = []byte(a.Inject)
+				}
+			case "log", "drop", "close":
+				// no extra fields to prepare
+			default:
+				return nil, fmt.Errorf("rule %q: unknown action type %q", r.Name, a.Type)
+			}
+		}
+	}
+
+	return &RuleEngine{Rules: doc.Rules, Log: NullLogger{}}, nil
+}
+
+// Result is the outcome of running a RuleEngine over one chunk of data.
+type Result struct {
+	Data  []byte
+	Drop  bool
+	Close bool
+}
+
+func (r *Rule) matches(dir Direction, b []byte) bool {
+	if r.Direction != Both && r.Direction != dir {
+		return false
+	}
+	if r.matchContains != nil && !bytes.Contains(b, r.matchContains) {
+		return false
+	}
+	if r.re != nil && !r.re.Match(b) {
+		return false
+	}
+	return r.matchContains != nil || r.re != nil
+}
+
+// Process runs every rule, in order, against b for the given direction.
+// Matched "inject" actions write their canned payload to reply, which the
+// caller must be the connection that sent b - i.e. a reply to the sender,
+// not a write onward to the other end - per the simplehttpserver-style
+// "response payload" this is modeled on. Processing short-circuits on the
+// first "drop" or "close" action.
+func (e *RuleEngine) Process(dir Direction, b []byte, reply io.Writer) Result {
+	for _, rule := range e.Rules {
+		if !rule.matches(dir, b) {
+			continue
+		}
+
+		n := atomic.AddUint64(&e.matchCount, 1)
+		e.Log.Info("Match #%d [rule=%s]", n, rule.Name)
+
+		for _, a := range rule.Actions {
+			switch a.Type {
+			case "log":
+				e.Log.Info("Rule %q matched %q data: %s", rule.Name, dir, string(b))
+			case "replace":
+				if rule.re != nil {
+					b = rule.re.ReplaceAll(b, a.replaceBytes)
+				} else {
+					b = bytes.ReplaceAll(b, rule.matchContains, a.replaceBytes)
+				}
+			case "inject":
+				if _, err := reply.Write(a.injectBytes); err != nil {
+					e.Log.Warn("Rule %q: inject write failed: %s", rule.Name, err)
+				}
+			case "drop":
+				return Result{Data: nil, Drop: true}
+			case "close":
+				return Result{Data: b, Close: true}
+			}
+		}
+	}
+
+	return Result{Data: b}
+}
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRuleEngineProcess_ReplaceRegex(t *testing.T) {
+	engine, err := ParseRuleEngine([]byte(`
+rules:
+  - name: redact
+    match: 'session=\w+'
+    actions:
+      - type: replace
+        replace: session=REDACTED
+`))
+	if err != nil {
+		t.Fatalf("ParseRuleEngine: %s", err)
+	}
+
+	var reply bytes.Buffer
+	result := engine.Process(Both, []byte("user=alice session=abc123"), &reply)
+	if string(result.Data) != "user=alice session=REDACTED" {
+		t.Fatalf("got %q", result.Data)
+	}
+	if result.Drop || result.Close {
+		t.Fatalf("result = %+v, want neither Drop nor Close", result)
+	}
+}
+
+func TestRuleEngineProcess_ReplaceHex(t *testing.T) {
+	engine, err := ParseRuleEngine([]byte(`
+rules:
+  - name: patch
+    match-contains: "MARKER"
+    actions:
+      - type: replace
+        hex: true
+        replace: "beef"
+`))
+	if err != nil {
+		t.Fatalf("ParseRuleEngine: %s", err)
+	}
+
+	var reply bytes.Buffer
+	result := engine.Process(Both, []byte("MARKER"), &reply)
+	if !bytes.Equal(result.Data, []byte{0xbe, 0xef}) {
+		t.Fatalf("got % x, want MARKER replaced with hex-decoded be ef", result.Data)
+	}
+}
+
+func TestRuleEngineProcess_DirectionFilter(t *testing.T) {
+	engine, err := ParseRuleEngine([]byte(`
+rules:
+  - name: server-only
+    match-contains: "secret"
+    direction: server->client
+    actions:
+      - type: replace
+        replace: REDACTED
+`))
+	if err != nil {
+		t.Fatalf("ParseRuleEngine: %s", err)
+	}
+
+	var reply bytes.Buffer
+	result := engine.Process(ClientToServer, []byte("secret"), &reply)
+	if string(result.Data) != "secret" {
+		t.Fatalf("rule fired on the wrong direction: got %q", result.Data)
+	}
+
+	result = engine.Process(ServerToClient, []byte("secret"), &reply)
+	if string(result.Data) != "REDACTED" {
+		t.Fatalf("rule did not fire on its configured direction: got %q", result.Data)
+	}
+}
+
+func TestRuleEngineProcess_Drop(t *testing.T) {
+	engine, err := ParseRuleEngine([]byte(`
+rules:
+  - name: block
+    match-contains: "blocked"
+    actions:
+      - type: drop
+`))
+	if err != nil {
+		t.Fatalf("ParseRuleEngine: %s", err)
+	}
+
+	var reply bytes.Buffer
+	result := engine.Process(Both, []byte("this is blocked"), &reply)
+	if !result.Drop {
+		t.Fatalf("result = %+v, want Drop", result)
+	}
+	if result.Data != nil {
+		t.Fatalf("dropped result.Data = %q, want nil", result.Data)
+	}
+}
+
+// TestRuleEngineProcess_CloseCarriesPrecedingData guards Process's own
+// contract: Result.Data from a rule matched up to and including a "close"
+// action must still carry whatever a preceding "replace" produced. (Proxy.pipe
+// actually writing that data out before tearing down the connection is
+// covered separately by TestPipeRuleCloseStillWritesPrecedingData.)
+func TestRuleEngineProcess_CloseCarriesPrecedingData(t *testing.T) {
+	engine, err := ParseRuleEngine([]byte(`
+rules:
+  - name: redact-and-close
+    match-contains: "secret"
+    actions:
+      - type: replace
+        replace: REDACTED
+      - type: close
+`))
+	if err != nil {
+		t.Fatalf("ParseRuleEngine: %s", err)
+	}
+
+	var reply bytes.Buffer
+	result := engine.Process(Both, []byte("this has secret data"), &reply)
+	if !result.Close {
+		t.Fatalf("result = %+v, want Close", result)
+	}
+	if string(result.Data) != "this has REDACTED data" {
+		t.Fatalf("got %q, want the replace action's output preserved", result.Data)
+	}
+}
+
+func TestRuleEngineProcess_InjectWritesToReply(t *testing.T) {
+	engine, err := ParseRuleEngine([]byte(`
+rules:
+  - name: ping-pong
+    match-contains: "ping"
+    actions:
+      - type: inject
+        inject: pong
+`))
+	if err != nil {
+		t.Fatalf("ParseRuleEngine: %s", err)
+	}
+
+	var reply bytes.Buffer
+	result := engine.Process(Both, []byte("ping"), &reply)
+	if reply.String() != "pong" {
+		t.Fatalf("reply = %q, want pong", reply.String())
+	}
+	if string(result.Data) != "ping" {
+		t.Fatalf("inject must not alter the data passed through: got %q", result.Data)
+	}
+}
+
+func TestRuleEngineProcess_RulesRunInOrderUntilShortCircuit(t *testing.T) {
+	engine, err := ParseRuleEngine([]byte(`
+rules:
+  - name: first
+    match-contains: "x"
+    actions:
+      - type: replace
+        replace: "1"
+  - name: second-drops
+    match-contains: "1"
+    actions:
+      - type: drop
+  - name: never-reached
+    match-contains: "1"
+    actions:
+      - type: replace
+        replace: "should not run"
+`))
+	if err != nil {
+		t.Fatalf("ParseRuleEngine: %s", err)
+	}
+
+	var reply bytes.Buffer
+	result := engine.Process(Both, []byte("x"), &reply)
+	if !result.Drop {
+		t.Fatalf("result = %+v, want the second rule's Drop to short-circuit the third", result)
+	}
+}
+
+func TestParseRuleEngine_RejectsUnknownActionType(t *testing.T) {
+	_, err := ParseRuleEngine([]byte(`
+rules:
+  - name: bad
+    match-contains: "x"
+    actions:
+      - type: teleport
+`))
+	if err == nil {
+		t.Fatalf("expected an error for an unknown action type")
+	}
+}
+
+func TestParseRuleEngine_RejectsMissingName(t *testing.T) {
+	_, err := ParseRuleEngine([]byte(`
+rules:
+  - match-contains: "x"
+    actions:
+      - type: log
+`))
+	if err == nil {
+		t.Fatalf("expected an error for a rule missing its required name")
+	}
+}
+
+func TestParseRuleEngine_RejectsInvalidRegex(t *testing.T) {
+	_, err := ParseRuleEngine([]byte(`
+rules:
+  - name: bad-regex
+    match: "("
+    actions:
+      - type: log
+`))
+	if err == nil {
+		t.Fatalf("expected an error for an invalid match regex")
+	}
+}
+
+func TestParseRuleEngine_DefaultsDirectionToBoth(t *testing.T) {
+	engine, err := ParseRuleEngine([]byte(`
+rules:
+  - name: either-way
+    match-contains: "x"
+    actions:
+      - type: drop
+`))
+	if err != nil {
+		t.Fatalf("ParseRuleEngine: %s", err)
+	}
+	if len(engine.Rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(engine.Rules))
+	}
+	if engine.Rules[0].Direction != Both {
+		t.Fatalf("Direction = %q, want the default %q", engine.Rules[0].Direction, Both)
+	}
+}
@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// errSniffingTimeout names the case of a Sniffer that can't reach a verdict
+// before its deadline. Route does not return it: on a timeout Route hands
+// back the default route instead.
+var errSniffingTimeout = errors.New("proxy: sniffing timed out")
+
+// Sniffer inspects the first bytes of a freshly accepted connection and
+// tries to extract a routing hint (e.g. a TLS SNI or HTTP Host) from them.
+// Sniff returns ("", err) if it cannot yet tell - ErrNeedMore to ask for
+// more bytes, or any other error to give up.
+type Sniffer interface {
+	// Sniff inspects buf (everything peeked so far) and returns the
+	// destination hostname it found, or ErrNeedMore if buf doesn't yet
+	// contain enough to decide.
+	Sniff(buf []byte) (host string, err error)
+}
+
+// ErrNeedMore signals that a Sniffer needs more peeked bytes before it can
+// decide.
+var ErrNeedMore = errors.New("proxy: need more data to sniff")
+
+// TLSSniffer extracts the SNI server_name from a TLS ClientHello record.
+type TLSSniffer struct{}
+
+const (
+	tlsRecordTypeHandshake  = 22
+	tlsHandshakeTypeClient  = 1
+	tlsExtensionServerName  = 0
+	tlsServerNameTypeDNSHdr = 0
+)
+
+// Sniff implements Sniffer for a raw TLS ClientHello record.
+func (TLSSniffer) Sniff(buf []byte) (string, error) {
+	if len(buf) < 5 {
+		return "", ErrNeedMore
+	}
+	if buf[0] != tlsRecordTypeHandshake {
+		return "", errors.New("proxy: not a TLS handshake record")
+	}
+
+	recordLen := int(buf[3])<<8 | int(buf[4])
+	if len(buf) < 5+recordLen {
+		return "", ErrNeedMore
+	}
+
+	hs := buf[5 : 5+recordLen]
+	if len(hs) < 4 || hs[0] != tlsHandshakeTypeClient {
+		return "", errors.New("proxy: not a ClientHello")
+	}
+
+	// ClientHello: msg type(1) + len(3) + version(2) + random(32) +
+	// session_id(1+n) + cipher_suites(2+n) + compression(1+n) + ext(2+n)
+	pos := 4 + 2 + 32
+	if pos >= len(hs) {
+		return "", ErrNeedMore
+	}
+
+	sessIDLen := int(hs[pos])
+	pos += 1 + sessIDLen
+	if pos+2 > len(hs) {
+		return "", ErrNeedMore
+	}
+
+	cipherLen := int(hs[pos])<<8 | int(hs[pos+1])
+	pos += 2 + cipherLen
+	if pos >= len(hs) {
+		return "", ErrNeedMore
+	}
+
+	compLen := int(hs[pos])
+	pos += 1 + compLen
+	if pos+2 > len(hs) {
+		return "", ErrNeedMore
+	}
+
+	extTotalLen := int(hs[pos])<<8 | int(hs[pos+1])
+	pos += 2
+	if pos+extTotalLen > len(hs) {
+		return "", ErrNeedMore
+	}
+
+	end := pos + extTotalLen
+	for pos+4 <= end {
+		extType := int(hs[pos])<<8 | int(hs[pos+1])
+		extLen := int(hs[pos+2])<<8 | int(hs[pos+3])
+		pos += 4
+		if pos+extLen > end {
+			return "", errors.New("proxy: malformed TLS extension")
+		}
+
+		if extType == tlsExtensionServerName {
+			name, ok := parseServerNameExtension(hs[pos : pos+extLen])
+			if ok {
+				return name, nil
+			}
+		}
+		pos += extLen
+	}
+
+	return "", errors.New("proxy: no server_name extension present")
+}
+
+func parseServerNameExtension(ext []byte) (string, bool) {
+	if len(ext) < 2 {
+		return "", false
+	}
+	listLen := int(ext[0])<<8 | int(ext[1])
+	pos := 2
+	if pos+listLen > len(ext) {
+		listLen = len(ext) - pos
+	}
+	end := pos + listLen
+	for pos+3 <= end {
+		nameType := ext[pos]
+		nameLen := int(ext[pos+1])<<8 | int(ext[pos+2])
+		pos += 3
+		if pos+nameLen > end {
+			return "", false
+		}
+		if nameType == tlsServerNameTypeDNSHdr {
+			return string(ext[pos : pos+nameLen]), true
+		}
+		pos += nameLen
+	}
+	return "", false
+}
+
+// HTTPSniffer extracts the Host header from a plaintext HTTP request.
+type HTTPSniffer struct{}
+
+// Sniff implements Sniffer, scanning up to the first blank line for Host:.
+func (HTTPSniffer) Sniff(buf []byte) (string, error) {
+	if i := bytes.Index(buf, []byte("\r\n\r\n")); i == -1 {
+		// Still look for Host: in what we have; only ask for more if the
+		// headers aren't finished and Host hasn't shown up yet.
+		if host, ok := scanHostHeader(buf); ok {
+			return host, nil
+		}
+		if len(buf) > 16*1024 {
+			return "", errors.New("proxy: no Host header found in request")
+		}
+		return "", ErrNeedMore
+	}
+
+	host, ok := scanHostHeader(buf)
+	if !ok {
+		return "", errors.New("proxy: no Host header found in request")
+	}
+	return host, nil
+}
+
+func scanHostHeader(buf []byte) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if len(line) > 5 && strings.EqualFold(line[:5], "host:") {
+			return strings.TrimSpace(line[5:]), true
+		}
+	}
+	return "", false
+}
+
+// peekedConn wraps a net.Conn so that bytes consumed while sniffing are
+// replayed to the first Read call, making the peek invisible to both ends.
+type peekedConn struct {
+	net.Conn
+	peeked *bytes.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	if c.peeked != nil {
+		n, err := c.peeked.Read(p)
+		if err == io.EOF {
+			c.peeked = nil
+			err = nil
+		}
+		if n > 0 {
+			return n, err
+		}
+	}
+	return c.Conn.Read(p)
+}
+
+// SniffTimeout is the default bound on how long Route will wait for a
+// Sniffer to reach a verdict before falling back to the default route.
+const SniffTimeout = 300 * time.Millisecond
+
+// Route sniffs conn with s and returns the replayable connection (with any
+// peeked bytes prepended back onto its Read stream) alongside the
+// destination host it found. If sniffing can't decide within timeout, or
+// errors, it returns defaultHost and a wrapped connection with whatever was
+// peeked so far still intact - that peek is never discarded, even on
+// timeout, so no bytes a slow client already sent are lost.
+//
+// The read loop runs on the calling goroutine, bounded by a deadline on
+// conn itself, rather than a background goroutine racing the timeout: a
+// goroutine blocked on conn.Read has no way to be cancelled short of
+// closing conn, and handing the connection to Proxy.pipe while that
+// goroutine was still running would have two readers racing on the same
+// net.Conn.
+func Route(conn net.Conn, s Sniffer, defaultHost string, timeout time.Duration) (net.Conn, string) {
+	if timeout <= 0 {
+		timeout = SniffTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return &peekedConn{Conn: conn, peeked: bytes.NewReader(nil)}, defaultHost
+	}
+	// Always clear the deadline before handing conn back, whether sniffing
+	// finished in time or not.
+	defer conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, 0, 4096)
+	tmp := make([]byte, 4096)
+	for {
+		n, err := conn.Read(tmp)
+		if n > 0 {
+			buf = append(buf, tmp[:n]...)
+		}
+		if err != nil {
+			return &peekedConn{Conn: conn, peeked: bytes.NewReader(buf)}, defaultHost
+		}
+
+		host, sniffErr := s.Sniff(buf)
+		if sniffErr == nil {
+			return &peekedConn{Conn: conn, peeked: bytes.NewReader(buf)}, host
+		}
+		if sniffErr != ErrNeedMore {
+			return &peekedConn{Conn: conn, peeked: bytes.NewReader(buf)}, defaultHost
+		}
+	}
+}
+
+// Router maps sniffed hostnames (supporting "*" glob patterns) to upstream
+// host:port addresses, with a fallback default for unmatched/unsniffable
+// connections.
+type Router struct {
+	Routes  map[string]string
+	Default string
+}
+
+// RouteFile is the top-level shape of a -route routes.yaml file.
+type RouteFile struct {
+	Routes  map[string]string `yaml:"routes"`
+	Default string            `yaml:"default"`
+}
+
+// Resolve returns the upstream address for host, matching glob patterns
+// (e.g. "*.example.com") before falling back to Default.
+func (r *Router) Resolve(host string) string {
+	if addr, ok := r.Routes[host]; ok {
+		return addr
+	}
+	for pattern, addr := range r.Routes {
+		if globMatch(pattern, host) {
+			return addr
+		}
+	}
+	return r.Default
+}
+
+// globMatch supports a single leading "*" wildcard, e.g. "*.example.com".
+func globMatch(pattern, s string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == s
+	}
+	suffix := strings.TrimPrefix(pattern, "*")
+	return strings.HasSuffix(s, suffix) && suffix != pattern
+}
+
+// LoadRouter reads and validates a -route routes.yaml file.
+func LoadRouter(path string) (*Router, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading routes file: %w", err)
+	}
+
+	var doc RouteFile
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing routes file: %w", err)
+	}
+	if doc.Default == "" {
+		return nil, fmt.Errorf("routes file missing required default upstream")
+	}
+
+	return &Router{Routes: doc.Routes, Default: doc.Default}, nil
+}
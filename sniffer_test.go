@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type neverSniffer struct{}
+
+func (neverSniffer) Sniff(buf []byte) (string, error) { return "", ErrNeedMore }
+
+// TestRoute_TimeoutPreservesPeekedBytes ensures that when sniffing can't
+// reach a verdict before the deadline, whatever was already read off the
+// connection is still replayed to the caller rather than discarded, and
+// that Route returns promptly instead of leaving a goroutine racing the
+// returned connection for reads.
+func TestRoute_TimeoutPreservesPeekedBytes(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	sent := []byte("partial-client-hello")
+	go func() {
+		client.Write(sent)
+		// Deliberately never send more: the sniffer (neverSniffer) can
+		// never reach a verdict, forcing Route to hit its timeout.
+	}()
+
+	start := time.Now()
+	wrapped, host := Route(server, neverSniffer{}, "default:80", 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Route took %s, want it to return promptly after its timeout", elapsed)
+	}
+	if host != "default:80" {
+		t.Fatalf("host = %q, want default:80", host)
+	}
+
+	got := make([]byte, len(sent))
+	if _, err := io.ReadFull(wrapped, got); err != nil {
+		t.Fatalf("reading replayed bytes: %s", err)
+	}
+	if string(got) != string(sent) {
+		t.Fatalf("replayed %q, want %q (peeked bytes were lost on timeout)", got, sent)
+	}
+}